@@ -0,0 +1,74 @@
+package store
+
+import "testing"
+
+func TestDelTreeRemovesEveryLeaf(t *testing.T) {
+	st := New()
+
+	pushAndWait(t, st, MustEncodeSet("/foo/a", "1", Missing))
+	pushAndWait(t, st, MustEncodeSet("/foo/b", "2", Missing))
+	pushAndWait(t, st, MustEncodeSet("/bar", "3", Missing))
+
+	pushAndWait(t, st, MustEncodeDelTree("/foo", Clobber))
+
+	if _, rev := st.Get("/foo/a"); rev != Missing {
+		t.Fatalf("/foo/a should be gone, got rev %d", rev)
+	}
+	if _, rev := st.Get("/foo/b"); rev != Missing {
+		t.Fatalf("/foo/b should be gone, got rev %d", rev)
+	}
+	if v, rev := st.Get("/bar"); rev == Missing || v[0] != "3" {
+		t.Fatalf("/bar should be untouched, got rev=%d v=%v", rev, v)
+	}
+}
+
+// Deleting an already-missing tree is a no-op, same as a plain Del of a
+// missing path.
+func TestDelTreeOnMissingPathIsNoop(t *testing.T) {
+	st := New()
+
+	pushAndWait(t, st, MustEncodeDelTree("/nope", Clobber))
+
+	if _, rev := st.Get("/nope"); rev != Missing {
+		t.Fatalf("expected /nope to stay missing, got rev %d", rev)
+	}
+}
+
+// A DelTree whose rev is older than some descendant's Rev fails the whole
+// subtree removal and reports the error at ErrorPath, leaving the tree
+// untouched.
+func TestDelTreeRevMismatchLeavesTreeIntact(t *testing.T) {
+	st := New()
+
+	pushAndWait(t, st, MustEncodeSet("/foo/a", "1", Missing))
+	pushAndWait(t, st, MustEncodeDelTree("/foo", 0))
+
+	if v, rev := st.Get("/foo/a"); rev == Missing || v[0] != "1" {
+		t.Fatalf("/foo/a should survive a stale DelTree rev, got rev=%d v=%v", rev, v)
+	}
+	if _, errRev := st.Get(ErrorPath); errRev == Missing {
+		t.Fatalf("expected a failed DelTree to write an error Event to %s", ErrorPath)
+	}
+}
+
+func TestWalkVisitsEveryLeaf(t *testing.T) {
+	st := New()
+
+	pushAndWait(t, st, MustEncodeSet("/foo/a", "1", Missing))
+	pushAndWait(t, st, MustEncodeSet("/foo/b", "2", Missing))
+
+	_, g := st.Snap()
+	root, ok := g.(node)
+	if !ok {
+		t.Fatal("Store's Getter is not the store's own node type")
+	}
+
+	seen := map[string]string{}
+	root.Walk("/foo", func(path, body string, rev int64) {
+		seen[path] = body
+	})
+
+	if seen["/foo/a"] != "1" || seen["/foo/b"] != "2" {
+		t.Fatalf("Walk did not visit every leaf under /foo, got %v", seen)
+	}
+}
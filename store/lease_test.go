@@ -0,0 +1,41 @@
+package store
+
+import (
+	"testing"
+	"time"
+)
+
+// Two leases expiring in the same timer tick must each have their Del
+// queued at a distinct Seqn. Before the fix, queueLeaseExpiry started a
+// fresh counter per lease, so the second lease's Del collided with the
+// first's and got silently dropped -- leaving its path permanent.
+func TestOverlappingLeaseExpiryBothApply(t *testing.T) {
+	st := New()
+
+	a := st.NewLease(20 * time.Millisecond)
+	b := st.NewLease(20 * time.Millisecond)
+
+	ma, err := EncodeSetLease("/a", "1", Missing, a)
+	if err != nil {
+		t.Fatal(err)
+	}
+	mb, err := EncodeSetLease("/b", "1", Missing, b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pushAndWait(t, st, ma)
+	pushAndWait(t, st, mb)
+
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		_, reva := st.Get("/a")
+		_, revb := st.Get("/b")
+		if reva == Missing && revb == Missing {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("both leases should have expired: /a rev=%d /b rev=%d", reva, revb)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
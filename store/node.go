@@ -1,6 +1,7 @@
 package store
 
 import (
+	"strings"
 	"syscall"
 )
 
@@ -139,23 +140,37 @@ func (n node) setp(k, v string, rev int64, keep bool) node {
 }
 
 // mut是一个复杂的字符串：
-//		ev.Path, ev.Body, rev, keep, ev.Err = decode(mut)
-func (n node) apply(seqn int64, mut string) (rep node, ev Event) {
+//		d, ev.Err = decode(mut)  // d.path, d.body, d.rev, d.keep, d.tree
+//
+// apply returns one Event per watcher-visible change at seqn. That's
+// almost always a single-element slice; applyDelTree is the one case that
+// can return more than one, so a glob watching under the deleted subtree
+// sees every path that went away instead of just the root.
+func (n node) apply(seqn int64, mut string) (rep node, evs []Event) {
+	var ev Event
 	ev.Seqn, ev.Rev, ev.Mut = seqn, seqn, mut
 	if mut == Nop {
 		ev.Path = "/"
 		ev.Rev = nop
 		rep = n
 		ev.Getter = rep
-		return
+		return rep, []Event{ev}
+	}
+
+	if strings.HasPrefix(mut, "txn:") {
+		return n.applyTxn(seqn, mut)
 	}
 
-	var rev int64
-	var keep bool
-	ev.Path, ev.Body, rev, keep, ev.Err = decode(mut)
+	d, err := decode(mut)
+	rev, keep := d.rev, d.keep
+	ev.Path, ev.Body, ev.Err = d.path, d.body, err
 	// value == "" return keep=false
 	// value != "" return keep=true
 
+	if d.tree && ev.Err == nil {
+		return n.applyDelTree(ev.Path, rev, seqn, mut)
+	}
+
 	if ev.Err == nil && keep {
 		// split() 里面假设路径以\开头， 但是在那里检测的？
 		// 这个路径上的节点必须都是DIR
@@ -191,5 +206,166 @@ func (n node) apply(seqn int64, mut string) (rep node, ev Event) {
 
 	rep = n.setp(ev.Path, ev.Body, ev.Rev, keep)
 	ev.Getter = rep
-	return
+	return rep, []Event{ev}
+}
+
+// applyDelTree removes the subtree rooted at path (path included) as a
+// single step. Unlike a plain Del, it's allowed to target a directory.
+// The whole operation fails, leaving n untouched, if rev is older than any
+// descendant's Rev (unless rev is Clobber).
+//
+// It returns one Event per leaf removed (path itself, if path names a
+// file) rather than a single Event for the root, so a watcher matching a
+// glob under path still sees every file that disappeared.
+func (n node) applyDelTree(path string, rev, seqn int64, mut string) (rep node, evs []Event) {
+	m, err := n.at(split(path))
+	if err == syscall.ENOENT {
+		// deleting an already-missing tree is a no-op, same as a plain Del.
+		rep = n
+		return rep, []Event{{Seqn: seqn, Rev: Missing, Mut: mut, Path: path, Getter: rep}}
+	}
+
+	if rev != Clobber && rev < maxRev(m) {
+		ev := Event{Seqn: seqn, Rev: seqn, Mut: mut, Err: ErrRevMismatch}
+		ev.Path, ev.Body = ErrorPath, ev.Err.Error()
+		rep = n.setp(ev.Path, ev.Body, Clobber, true)
+		ev.Getter = rep
+		return rep, []Event{ev}
+	}
+
+	var leaves []string
+	m.walk(path, func(p, body string, leafRev int64) {
+		leaves = append(leaves, p)
+	})
+
+	rep = n.setp(path, "", Missing, false)
+	evs = make([]Event, len(leaves))
+	for i, p := range leaves {
+		evs[i] = Event{Seqn: seqn, Rev: Missing, Mut: mut, Path: p, Getter: rep}
+	}
+	return rep, evs
+}
+
+// applyTxn evaluates every guard of a `txn:` mutation against n (the
+// pre-image) and, only if they all pass, applies every op atomically at
+// seqn. An op that would leave the tree inconsistent (ENOTDIR/EISDIR,
+// the same checks apply() runs for a plain Set/Del) fails the whole txn
+// just like a guard failure would. Either way, n is rolled back to (left
+// as) the original node, and a single error Event is written to ErrorPath
+// instead -- the same way any other failed mutation is reported.
+func (n node) applyTxn(seqn int64, mut string) (rep node, evs []Event) {
+	ev := Event{Seqn: seqn, Rev: seqn, Mut: mut}
+
+	guards, ops, err := decodeTxn(mut)
+	if err == nil {
+		for _, g := range guards {
+			_, curRev := n.Get(g.path)
+			if g.exists {
+				if curRev == Missing {
+					err = ErrRevMismatch
+				}
+			} else if curRev != g.rev {
+				err = ErrRevMismatch
+			}
+			if err != nil {
+				break
+			}
+		}
+	}
+
+	rep = n
+	if err == nil {
+		for _, o := range ops {
+			if o.path == "" {
+				continue // NopOp
+			}
+
+			if o.keep {
+				components := split(o.path)
+				for i := 0; i < len(components)-1; i++ {
+					_, dirRev := rep.get(components[0 : i+1])
+					if dirRev == Missing {
+						break
+					}
+					if dirRev != Dir {
+						err = syscall.ENOTDIR
+						break
+					}
+				}
+			}
+			if err == nil {
+				if _, curRev := rep.Get(o.path); curRev == Dir {
+					err = syscall.EISDIR
+				}
+			}
+			if err != nil {
+				break
+			}
+
+			rev := seqn
+			if !o.keep {
+				rev = Missing
+			}
+			rep = rep.setp(o.path, o.v, rev, o.keep)
+		}
+	}
+
+	if err != nil {
+		ev.Err = err
+		ev.Path, ev.Body = ErrorPath, err.Error()
+		rep = n.setp(ev.Path, ev.Body, Clobber, true)
+		ev.Getter = rep
+		return rep, []Event{ev}
+	}
+
+	ev.Path, ev.Rev = "/", seqn
+	ev.Getter = rep
+	return rep, []Event{ev}
+}
+
+// maxRev returns the highest leaf Rev found anywhere in m's subtree. Dir
+// nodes carry the sentinel Rev Dir rather than a real revision, so only
+// leaves are compared.
+func maxRev(m node) int64 {
+	if len(m.Ds) == 0 {
+		return m.Rev
+	}
+
+	r := Missing
+	for _, c := range m.Ds {
+		if cr := maxRev(c); cr > r {
+			r = cr
+		}
+	}
+	return r
+}
+
+// Walk visits every leaf file in the subtree rooted at path (path itself
+// included if it is a file), calling fn with each one's path, body and
+// Rev. It lets in-process callers recurse over a snapshot directly,
+// instead of walking it file-by-file the way the external doozer.Walk
+// helper has to over the wire.
+func (n node) Walk(path string, fn func(path, body string, rev int64)) {
+	m, err := n.at(split(path))
+	if err != nil {
+		return
+	}
+	m.walk(path, fn)
+}
+
+func (n node) walk(path string, fn func(path, body string, rev int64)) {
+	if len(n.Ds) == 0 {
+		fn(path, n.V, n.Rev)
+		return
+	}
+
+	for name, c := range n.Ds {
+		p := name
+		if path != "/" {
+			p = path + "/" + name
+		} else {
+			p = "/" + name
+		}
+		c.walk(p, fn)
+	}
 }
@@ -0,0 +1,357 @@
+package store
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"io"
+	"time"
+)
+
+// snapshotVersion is bumped whenever the wire format below changes in an
+// incompatible way. LoadSnapshot refuses to read anything else.
+const snapshotVersion = 1
+
+var ErrSnapshotVersion = errors.New("store: unsupported snapshot version")
+
+// A Snapshotter writes a point-in-time copy of a Store's tree, and the
+// Events applied after it, so a new replica can bootstrap without
+// replaying every mutation since Seqn 1.
+type Snapshotter struct {
+	st *Store
+}
+
+// NewSnapshotter returns a Snapshotter for st.
+func NewSnapshotter(st *Store) *Snapshotter {
+	return &Snapshotter{st: st}
+}
+
+// WriteTo writes the store's current tree to w in a stable, versioned
+// binary format, with every node's Rev included, along with every
+// outstanding lease (so ephemeral files stay ephemeral on the new
+// replica instead of becoming permanent). It returns the rev the snapshot
+// was taken at; a follow-on call to WriteDelta(w, rev+1) carries
+// everything applied since.
+func (s *Snapshotter) WriteTo(w io.Writer) (rev int64, err error) {
+	ver, g := s.st.Snap()
+	root, ok := g.(node)
+	if !ok {
+		return 0, errors.New("store: Snapshotter requires the Store's own Getter")
+	}
+	leases := s.st.leaseSnapshots()
+
+	bw := bufio.NewWriter(w)
+	if err = writeUint32(bw, snapshotVersion); err != nil {
+		return 0, err
+	}
+	if err = writeInt64(bw, ver); err != nil {
+		return 0, err
+	}
+	if err = writeNode(bw, root); err != nil {
+		return 0, err
+	}
+	if err = writeLeases(bw, leases); err != nil {
+		return 0, err
+	}
+	return ver, bw.Flush()
+}
+
+func writeLeases(w io.Writer, leases []leaseSnapshot) error {
+	if err := writeInt64(w, int64(len(leases))); err != nil {
+		return err
+	}
+	for _, ls := range leases {
+		if err := writeInt64(w, int64(ls.id)); err != nil {
+			return err
+		}
+		if err := writeInt64(w, int64(ls.ttl/time.Second)); err != nil {
+			return err
+		}
+		remaining := ls.remaining
+		if remaining < 0 {
+			remaining = 0
+		}
+		if err := writeInt64(w, int64(remaining/time.Second)); err != nil {
+			return err
+		}
+		if err := writeInt64(w, int64(len(ls.paths))); err != nil {
+			return err
+		}
+		for _, p := range ls.paths {
+			if err := writeString(w, p); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func readLeases(r io.Reader) ([]leaseSnapshot, error) {
+	n, err := readInt64(r)
+	if err != nil {
+		return nil, err
+	}
+
+	leases := make([]leaseSnapshot, n)
+	for i := range leases {
+		id, err := readInt64(r)
+		if err != nil {
+			return nil, err
+		}
+		ttl, err := readInt64(r)
+		if err != nil {
+			return nil, err
+		}
+		remaining, err := readInt64(r)
+		if err != nil {
+			return nil, err
+		}
+		pathCount, err := readInt64(r)
+		if err != nil {
+			return nil, err
+		}
+		paths := make([]string, pathCount)
+		for j := range paths {
+			paths[j], err = readString(r)
+			if err != nil {
+				return nil, err
+			}
+		}
+		leases[i] = leaseSnapshot{
+			id:        LeaseID(id),
+			ttl:       time.Duration(ttl) * time.Second,
+			remaining: time.Duration(remaining) * time.Second,
+			paths:     paths,
+		}
+	}
+	return leases, nil
+}
+
+// WriteDelta streams every Event retained for seqns >= sinceRev as a replay
+// log, in order. The receiving end feeds it back through a Store's Ops
+// channel followed by Flush, the same way it would apply any other burst
+// of buffered mutations.
+//
+// WriteDelta only sees what Clean hasn't pruned yet, so sinceRev must be
+// requested before calling Clean with a seqn >= sinceRev.
+func (s *Snapshotter) WriteDelta(w io.Writer, sinceRev int64) error {
+	ver, _ := s.st.Snap()
+	evs := s.st.Events(sinceRev, ver)
+
+	bw := bufio.NewWriter(w)
+	if err := writeInt64(bw, int64(len(evs))); err != nil {
+		return err
+	}
+	for _, e := range evs {
+		if err := writeInt64(bw, e.Seqn); err != nil {
+			return err
+		}
+		if err := writeString(bw, e.Mut); err != nil {
+			return err
+		}
+	}
+	return bw.Flush()
+}
+
+// DeltaOp is one record of a stream written by WriteDelta.
+type DeltaOp struct {
+	Seqn int64
+	Mut  string
+}
+
+// ReadDelta reads a stream written by WriteDelta back into a slice of
+// DeltaOp, each ready to be sent on a Store's Ops channel as an Op.
+func ReadDelta(r io.Reader) ([]DeltaOp, error) {
+	br := bufio.NewReader(r)
+
+	n, err := readInt64(br)
+	if err != nil {
+		return nil, err
+	}
+
+	ops := make([]DeltaOp, n)
+	for i := range ops {
+		seqn, err := readInt64(br)
+		if err != nil {
+			return nil, err
+		}
+		mut, err := readString(br)
+		if err != nil {
+			return nil, err
+		}
+		ops[i] = DeltaOp{seqn, mut}
+	}
+	return ops, nil
+}
+
+// LoadSnapshot reconstructs a Store from a snapshot written by
+// Snapshotter.WriteTo, with head and the current state primed at the
+// snapshot's rev. The caller is expected to follow up by pushing a delta
+// stream (read with ReadDelta) onto the returned Store's Ops channel and
+// calling Flush, to catch the new replica up to the present.
+func LoadSnapshot(r io.Reader) (*Store, error) {
+	br := bufio.NewReader(r)
+
+	version, err := readUint32(br)
+	if err != nil {
+		return nil, err
+	}
+	if version != snapshotVersion {
+		return nil, ErrSnapshotVersion
+	}
+
+	ver, err := readInt64(br)
+	if err != nil {
+		return nil, err
+	}
+
+	root, err := readNode(br)
+	if err != nil {
+		return nil, err
+	}
+
+	leases, err := readLeases(br)
+	if err != nil {
+		return nil, err
+	}
+
+	st := New()
+	st.primeCh <- primeReq{ver: ver, root: root, leases: leases}
+	// process answers on Seqns only once it has finished the prime request,
+	// so the Store isn't handed back until its state is in place.
+	<-st.Seqns
+	return st, nil
+}
+
+func writeNode(w io.Writer, n node) error {
+	if len(n.Ds) > 0 {
+		if err := writeByte(w, 1); err != nil {
+			return err
+		}
+		if err := writeInt64(w, n.Rev); err != nil {
+			return err
+		}
+		if err := writeInt64(w, int64(len(n.Ds))); err != nil {
+			return err
+		}
+		for name, c := range n.Ds {
+			if err := writeString(w, name); err != nil {
+				return err
+			}
+			if err := writeNode(w, c); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	if err := writeByte(w, 0); err != nil {
+		return err
+	}
+	if err := writeInt64(w, n.Rev); err != nil {
+		return err
+	}
+	return writeString(w, n.V)
+}
+
+func readNode(r io.Reader) (node, error) {
+	kind, err := readByte(r)
+	if err != nil {
+		return node{}, err
+	}
+
+	rev, err := readInt64(r)
+	if err != nil {
+		return node{}, err
+	}
+
+	if kind == 0 {
+		v, err := readString(r)
+		if err != nil {
+			return node{}, err
+		}
+		return node{V: v, Rev: rev}, nil
+	}
+
+	count, err := readInt64(r)
+	if err != nil {
+		return node{}, err
+	}
+
+	ds := make(map[string]node, count)
+	for i := int64(0); i < count; i++ {
+		name, err := readString(r)
+		if err != nil {
+			return node{}, err
+		}
+		c, err := readNode(r)
+		if err != nil {
+			return node{}, err
+		}
+		ds[name] = c
+	}
+	return node{Rev: rev, Ds: ds}, nil
+}
+
+func writeByte(w io.Writer, b byte) error {
+	_, err := w.Write([]byte{b})
+	return err
+}
+
+func readByte(r io.Reader) (byte, error) {
+	var b [1]byte
+	if _, err := io.ReadFull(r, b[:]); err != nil {
+		return 0, err
+	}
+	return b[0], nil
+}
+
+func writeUint32(w io.Writer, v uint32) error {
+	var b [4]byte
+	binary.BigEndian.PutUint32(b[:], v)
+	_, err := w.Write(b[:])
+	return err
+}
+
+func readUint32(r io.Reader) (uint32, error) {
+	var b [4]byte
+	if _, err := io.ReadFull(r, b[:]); err != nil {
+		return 0, err
+	}
+	return binary.BigEndian.Uint32(b[:]), nil
+}
+
+func writeInt64(w io.Writer, v int64) error {
+	var b [8]byte
+	binary.BigEndian.PutUint64(b[:], uint64(v))
+	_, err := w.Write(b[:])
+	return err
+}
+
+func readInt64(r io.Reader) (int64, error) {
+	var b [8]byte
+	if _, err := io.ReadFull(r, b[:]); err != nil {
+		return 0, err
+	}
+	return int64(binary.BigEndian.Uint64(b[:])), nil
+}
+
+func writeString(w io.Writer, s string) error {
+	if err := writeInt64(w, int64(len(s))); err != nil {
+		return err
+	}
+	_, err := io.WriteString(w, s)
+	return err
+}
+
+func readString(r io.Reader) (string, error) {
+	n, err := readInt64(r)
+	if err != nil {
+		return "", err
+	}
+	b := make([]byte, n)
+	if _, err := io.ReadFull(r, b); err != nil {
+		return "", err
+	}
+	return string(b), nil
+}
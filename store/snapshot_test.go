@@ -0,0 +1,84 @@
+package store
+
+import (
+	"bytes"
+	"testing"
+	"time"
+)
+
+func TestSnapshotRoundTrip(t *testing.T) {
+	st := New()
+
+	pushAndWait(t, st, MustEncodeSet("/a", "1", Missing))
+	lease := st.NewLease(time.Hour)
+	mlease, err := EncodeSetLease("/eph", "x", Missing, lease)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pushAndWait(t, st, mlease)
+
+	snap := NewSnapshotter(st)
+	var buf bytes.Buffer
+	rev, err := snap.WriteTo(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	restored, err := LoadSnapshot(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if v, r := restored.Get("/a"); r != 1 || v[0] != "1" {
+		t.Fatalf("/a not restored: rev=%d v=%v", r, v)
+	}
+	if v, r := restored.Get("/eph"); r == Missing || v[0] != "x" {
+		t.Fatalf("/eph not restored: rev=%d v=%v", r, v)
+	}
+	if gotVer, _ := restored.Snap(); gotVer != rev {
+		t.Fatalf("restored ver=%d, want %d", gotVer, rev)
+	}
+}
+
+// A snapshot plus the delta shipped for everything applied after it should
+// leave a fresh replica caught up to the source.
+func TestSnapshotDeltaRoundTrip(t *testing.T) {
+	st := New()
+
+	base := pushAndWait(t, st, MustEncodeSet("/a", "1", Missing))
+	snap := NewSnapshotter(st)
+	var snapBuf bytes.Buffer
+	if _, err := snap.WriteTo(&snapBuf); err != nil {
+		t.Fatal(err)
+	}
+
+	pushAndWait(t, st, MustEncodeSet("/b", "2", Missing))
+	pushAndWait(t, st, MustEncodeSet("/c", "3", Missing))
+
+	var deltaBuf bytes.Buffer
+	if err := snap.WriteDelta(&deltaBuf, base+1); err != nil {
+		t.Fatal(err)
+	}
+
+	restored, err := LoadSnapshot(&snapBuf)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ops, err := ReadDelta(&deltaBuf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, op := range ops {
+		restored.Ops <- Op{Seqn: op.Seqn, Mut: op.Mut}
+	}
+	restored.Flush()
+	<-restored.Seqns
+
+	if v, r := restored.Get("/b"); r == Missing || v[0] != "2" {
+		t.Fatalf("/b not caught up via delta: rev=%d v=%v", r, v)
+	}
+	if v, r := restored.Get("/c"); r == Missing || v[0] != "3" {
+		t.Fatalf("/c not caught up via delta: rev=%d v=%v", r, v)
+	}
+}
@@ -6,6 +6,8 @@ import (
 	"regexp"
 	"strconv"
 	"strings"
+	"sync"
+	"time"
 )
 
 // Special values for a revision.
@@ -46,6 +48,12 @@ type Store struct {
 	Waiting <-chan int
 	// 新 watcher
 	watchCh chan *watch
+	// 取消订阅的 watcher (只用于 persistent watch)
+	unwatchCh chan *watch
+	// 查询保留的历史 log（给 Snapshotter 增量导出用）
+	logReqCh chan logReq
+	// Snapshotter/LoadSnapshot 用来灌入初始状态
+	primeCh chan primeReq
 	// 还未触发的 watcher, 未来触发
 	watches []*watch
 	// 未来的操作, 版本号 >= targetVer 时才触发。
@@ -53,12 +61,43 @@ type Store struct {
 	// 里面放存储
 	state   *state
 	head    int64
-	// 历史版本数据
-	log     map[int64]Event
+	// 历史版本数据，一个 Seqn 可能对应多个 Event（比如 DelTree）
+	log     map[int64][]Event
 	cleanCh chan int64
 	flush   chan bool
+
+	newLeaseCh    chan newLeaseReq
+	renewLeaseCh  chan LeaseID
+	revokeLeaseCh chan LeaseID
+	leasesReqCh   chan leasesReq
+	leaseTimer    *time.Timer
+	leases        map[LeaseID]*leaseState
+	nextLease     LeaseID
+}
+
+// A LeaseID names a session lease created by Store.NewLease. It's attached
+// to Set mutations via an ";lease=<id>" suffix (see EncodeSetLease) to mark
+// their file as ephemeral: gone automatically once the lease expires or is
+// revoked.
+type LeaseID int64
+
+// leaseState tracks one outstanding lease: when it expires, and which
+// paths are attached to it and so should be deleted at that point.
+type leaseState struct {
+	ttl     time.Duration
+	expires time.Time
+	paths   map[string]bool
 }
 
+type newLeaseReq struct {
+	ttl  time.Duration
+	resp chan LeaseID
+}
+
+// leaseIdleInterval is how long the lease timer sleeps for when there are
+// no outstanding leases, just so it has somewhere to wake up to next.
+const leaseIdleInterval = time.Hour
+
 // Represents an operation to apply to the store at position Seqn.
 //
 // If Mut is Nop, no change will be made, but an event will still be sent.
@@ -73,10 +112,45 @@ type state struct {
 	root node
 }
 
+// A request for the Events retained for Seqns in [from, to]; answered by
+// process over resp.
+type logReq struct {
+	from, to int64
+	resp     chan []Event
+}
+
+// Used by LoadSnapshot to prime a freshly created Store's state before
+// anything else can observe it.
+type primeReq struct {
+	ver    int64
+	root   node
+	leases []leaseSnapshot
+}
+
+// A point-in-time copy of one lease, used to persist/restore leases across
+// a Snapshotter/LoadSnapshot round trip. remaining (rather than an
+// absolute expiry) is what actually survives the round trip, since the
+// wall clock of the process loading the snapshot has no relation to the
+// one that wrote it.
+type leaseSnapshot struct {
+	id        LeaseID
+	ttl       time.Duration
+	remaining time.Duration
+	paths     []string
+}
+
+type leasesReq struct {
+	resp chan []leaseSnapshot
+}
+
 type watch struct {
 	glob *Glob
 	rev  int64
 	c    chan<- Event
+	// persistent watches (created by Watch, as opposed to Wait) are
+	// re-queued by process after each matching Event instead of being
+	// dropped once they fire.
+	persistent bool
 }
 
 // Creates a new, empty data store. Mutations will be applied in order,
@@ -88,15 +162,25 @@ func New() *Store {
 	watches := make(chan int)
 
 	st := &Store{
-		Ops:     ops,
-		Seqns:   seqns,
-		Waiting: watches,
-		watchCh: make(chan *watch),
-		watches: []*watch{},
-		state:   &state{0, emptyDir},
-		log:     map[int64]Event{},			// 历史版本数据
-		cleanCh: make(chan int64),
-		flush:   make(chan bool),
+		Ops:       ops,
+		Seqns:     seqns,
+		Waiting:   watches,
+		watchCh:   make(chan *watch),
+		unwatchCh: make(chan *watch),
+		logReqCh:  make(chan logReq),
+		primeCh:   make(chan primeReq),
+		watches:   []*watch{},
+		state:     &state{0, emptyDir},
+		log:       map[int64][]Event{}, // 历史版本数据
+		cleanCh:   make(chan int64),
+		flush:     make(chan bool),
+
+		newLeaseCh:    make(chan newLeaseReq),
+		renewLeaseCh:  make(chan LeaseID),
+		revokeLeaseCh: make(chan LeaseID),
+		leasesReqCh:   make(chan leasesReq),
+		leaseTimer:    time.NewTimer(leaseIdleInterval),
+		leases:        map[LeaseID]*leaseState{},
 	}
 
 	go st.process(ops, seqns, watches)
@@ -171,11 +255,244 @@ func MustEncodeDel(path string, rev int64) (mutation string) {
 	return m
 }
 
+// Returns a mutation that can be applied to a `Store`. The mutation will
+// remove `path` and everything below it, atomically, in a single Seqn, iff
+// `rev` is greater than or equal to the revision of every descendant file,
+// with one exception: if `rev` is Clobber, the tree is removed
+// unconditionally. It is the recursive counterpart to EncodeDel.
+func EncodeDelTree(path string, rev int64) (mutation string, err error) {
+	if err = checkPath(path); err != nil {
+		return
+	}
+	return strconv.FormatInt(rev, 10) + ":" + path + "/**", nil
+}
+
+// MustEncodeDelTree is like EncodeDelTree but panics if the mutation cannot
+// be encoded. It simplifies safe initialization of global variables holding
+// mutations.
+func MustEncodeDelTree(path string, rev int64) (mutation string) {
+	m, err := EncodeDelTree(path, rev)
+	if err != nil {
+		panic(err)
+	}
+	return m
+}
+
+// A TxnGuard conditions a transactional mutation (see EncodeTxn) on the
+// state of a single path. Build one with RevGuard or ExistsGuard.
+type TxnGuard struct {
+	path   string
+	rev    int64
+	exists bool
+}
+
+// RevGuard guards a transaction on path's revision being exactly rev,
+// failing the whole transaction with ErrRevMismatch otherwise.
+func RevGuard(path string, rev int64) TxnGuard {
+	return TxnGuard{path: path, rev: rev}
+}
+
+// ExistsGuard guards a transaction on path existing (having a revision
+// other than Missing), regardless of what that revision actually is.
+func ExistsGuard(path string) TxnGuard {
+	return TxnGuard{path: path, exists: true}
+}
+
+// A TxnOp is one write a transactional mutation performs if all of its
+// guards pass. Build one with SetOp, DelOp or NopOp.
+type TxnOp struct {
+	path string
+	v    string
+	keep bool
+}
+
+// SetOp sets path to body.
+func SetOp(path, body string) TxnOp {
+	return TxnOp{path: path, v: body, keep: true}
+}
+
+// DelOp deletes path.
+func DelOp(path string) TxnOp {
+	return TxnOp{path: path}
+}
+
+// NopOp performs no write. It's only useful to pad out a transaction built
+// programmatically, where the number of ops is otherwise fixed.
+func NopOp() TxnOp {
+	return TxnOp{}
+}
+
+// Returns a mutation that can be applied to a `Store`. The mutation
+// atomically evaluates every guard against the pre-image and, only if they
+// all pass, applies every op at the same Seqn; if any guard fails, none of
+// the ops are applied and a single error Event is written to ErrorPath
+// instead. It's the multi-key, compare-and-swap counterpart to
+// EncodeSet/EncodeDel.
+func EncodeTxn(guards []TxnGuard, ops []TxnOp) (mutation string, err error) {
+	parts := make([]string, 0, len(guards)+len(ops))
+
+	for _, g := range guards {
+		if err = checkPath(g.path); err != nil {
+			return
+		}
+		if g.exists {
+			parts = append(parts, g.path+"?exists")
+		} else {
+			parts = append(parts, g.path+"@"+strconv.FormatInt(g.rev, 10))
+		}
+	}
+
+	for _, o := range ops {
+		if o.path == "" {
+			parts = append(parts, "")
+			continue
+		}
+		if err = checkPath(o.path); err != nil {
+			return
+		}
+		if o.keep {
+			parts = append(parts, o.path+"="+o.v)
+		} else {
+			parts = append(parts, o.path)
+		}
+	}
+
+	mutation = "txn:" + strconv.Itoa(len(guards)) + ":" + strconv.Itoa(len(ops)) +
+		":" + strings.Join(parts, ";")
+	return
+}
+
+// decoded form of a single guard within a txn: mutation, see decodeTxn.
+type txnGuard struct {
+	path   string
+	rev    int64
+	exists bool
+}
+
+// decoded form of a single op within a txn: mutation, see decodeTxn.
+type txnOp struct {
+	path string
+	v    string
+	keep bool
+}
+
+// decodeTxn parses a `txn:<n-guards>:<n-ops>:guard1;...;op1;...` mutation.
+func decodeTxn(mutation string) (guards []txnGuard, ops []txnOp, err error) {
+	rest := strings.TrimPrefix(mutation, "txn:")
+	parts := strings.SplitN(rest, ":", 3)
+	if len(parts) != 3 {
+		err = ErrBadMutation
+		return
+	}
+
+	nGuards, err := strconv.Atoi(parts[0])
+	if err != nil {
+		return
+	}
+	nOps, err := strconv.Atoi(parts[1])
+	if err != nil {
+		return
+	}
+
+	var items []string
+	if nGuards+nOps > 0 {
+		items = strings.Split(parts[2], ";")
+	}
+	if len(items) != nGuards+nOps {
+		err = ErrBadMutation
+		return
+	}
+
+	for _, g := range items[:nGuards] {
+		if strings.HasSuffix(g, "?exists") {
+			path := strings.TrimSuffix(g, "?exists")
+			if err = checkPath(path); err != nil {
+				return
+			}
+			guards = append(guards, txnGuard{path: path, exists: true})
+			continue
+		}
+
+		i := strings.LastIndex(g, "@")
+		if i < 0 {
+			err = ErrBadMutation
+			return
+		}
+
+		path := g[:i]
+		var rev int64
+		rev, err = strconv.ParseInt(g[i+1:], 10, 64)
+		if err != nil {
+			return
+		}
+		if err = checkPath(path); err != nil {
+			return
+		}
+		guards = append(guards, txnGuard{path: path, rev: rev})
+	}
+
+	for _, o := range items[nGuards:] {
+		if o == "" {
+			ops = append(ops, txnOp{})
+			continue
+		}
+
+		kv := strings.SplitN(o, "=", 2)
+		if err = checkPath(kv[0]); err != nil {
+			return
+		}
+
+		switch len(kv) {
+		case 1:
+			ops = append(ops, txnOp{path: kv[0]})
+		case 2:
+			ops = append(ops, txnOp{path: kv[0], v: kv[1], keep: true})
+		}
+	}
+
+	return
+}
+
+// stripLeaseSuffix splits a trailing ";lease=<id>" or ";ttl=<seconds>" off
+// s. Set mutations carry one of these to tie the file to a session lease
+// (see Store.NewLease): when the lease expires or is revoked, the file is
+// removed automatically. At most one of hasLease/hasTTL is ever true.
+func stripLeaseSuffix(s string) (rest string, leaseID LeaseID, hasLease bool, ttl time.Duration, hasTTL bool) {
+	if i := strings.LastIndex(s, ";lease="); i >= 0 {
+		if n, err := strconv.ParseInt(s[i+len(";lease="):], 10, 64); err == nil {
+			return s[:i], LeaseID(n), true, 0, false
+		}
+	}
+	if i := strings.LastIndex(s, ";ttl="); i >= 0 {
+		if secs, err := strconv.ParseInt(s[i+len(";ttl="):], 10, 64); err == nil {
+			return s[:i], 0, false, time.Duration(secs) * time.Second, true
+		}
+	}
+	return s, 0, false, 0, false
+}
+
+// decoded is the parsed form of a `REV:KEY`, `REV:KEY=VALUE` or
+// `REV:KEY/**` mutation.
+type decoded struct {
+	path string
+	body string
+	rev  int64
+	// keep 是个什么含义？keep=false 是删除，keep=true 是写入
+	keep bool
+	// tree 为 true 时表示这是一个 EncodeDelTree 产生的递归删除
+	tree bool
+
+	leaseID  LeaseID
+	hasLease bool
+	ttl      time.Duration
+	hasTTL   bool
+}
+
 // Mut 串结构：
 //	REV:KEY=VALUE
 //	REV:KEY		这是一个删除操作？？？
-// keep 是个什么含义？
-func decode(mutation string) (path, v string, rev int64, keep bool, err error) {
+//	REV:KEY/**	递归删除 KEY 为根的整棵子树
+func decode(mutation string) (d decoded, err error) {
 	cm := strings.SplitN(mutation, ":", 2)
 
 	if len(cm) != 2 {
@@ -183,33 +500,88 @@ func decode(mutation string) (path, v string, rev int64, keep bool, err error) {
 		return
 	}
 
-	rev, err = strconv.ParseInt(cm[0], 10, 64)
+	d.rev, err = strconv.ParseInt(cm[0], 10, 64)
 	if err != nil {
 		return
 	}
 
-	kv := strings.SplitN(cm[1], "=", 2)
+	rest, leaseID, hasLease, ttl, hasTTL := stripLeaseSuffix(cm[1])
+	kv := strings.SplitN(rest, "=", 2)
+
+	d.path = kv[0]
+	if strings.HasSuffix(d.path, "/**") {
+		d.tree = true
+		d.path = strings.TrimSuffix(d.path, "/**")
+	}
 
-	if err = checkPath(kv[0]); err != nil {
+	if err = checkPath(d.path); err != nil {
 		return
 	}
 
 	switch len(kv) {
 	case 1:
-		return kv[0], "", rev, false, nil
+		return d, nil
 	case 2:
-		return kv[0], kv[1], rev, true, nil
+		if d.tree {
+			// a tree delete carries no value
+			err = ErrBadMutation
+			return
+		}
+		d.body, d.keep = kv[1], true
+		d.leaseID, d.hasLease, d.ttl, d.hasTTL = leaseID, hasLease, ttl, hasTTL
+		return d, nil
 	}
 	panic("unreachable")
 }
 
-// watch 是一次性的
+// watch 默认是一次性的，persistent 的会在触发后重新放回 nws
 // 看调用方，历史版本从小版本号开始比较
-func (st *Store) notify(e Event, ws []*watch) (nws []*watch) {
+//
+// evs holds every Event for a single Seqn (more than one only for a
+// multi-leaf DelTree). A persistent watch's rev is rearmed once, after all
+// of evs has been checked against it -- not after the first match -- so a
+// second leaf at the same Seqn isn't dropped by its own e.Seqn < w.rev
+// check.
+func (st *Store) notify(evs []Event, ws []*watch) (nws []*watch) {
 	for _, w := range ws {
-		if e.Seqn >= w.rev && w.glob.Match(e.Path) {
-			w.c <- e
-		} else {
+		keep := true
+		rev := w.rev
+
+		for _, e := range evs {
+			if e.Seqn < w.rev || !w.glob.Match(e.Path) {
+				continue
+			}
+
+			if !w.persistent {
+				w.c <- e
+				keep = false
+				break
+			}
+
+			select {
+			case w.c <- e:
+			default:
+				// slow consumer: the buffer is full, so evict its oldest
+				// entry to make room, then drop e and leave a gap marker in
+				// its place so the consumer notices via ErrTooLate and
+				// resyncs with Snap instead of silently missing an update.
+				select {
+				case <-w.c:
+				default:
+				}
+				select {
+				case w.c <- Event{Seqn: e.Seqn, Err: ErrTooLate}:
+				default:
+				}
+			}
+
+			rev = e.Seqn + 1
+		}
+
+		if w.persistent {
+			w.rev = rev
+		}
+		if keep {
 			nws = append(nws, w)
 		}
 	}
@@ -258,10 +630,90 @@ func (st *Store) process(ops <-chan Op, seqns chan<- int64, watches chan<- int)
 			}
 
 			st.watches = append(st.watches, ws...)
+		case w := <-st.unwatchCh:
+			for i, x := range st.watches {
+				if x == w {
+					st.watches = append(st.watches[:i], st.watches[i+1:]...)
+					close(w.c)
+					break
+				}
+			}
 		case seqn := <-st.cleanCh:
 			for ; st.head <= seqn; st.head++ {
 				delete(st.log, st.head)
 			}
+		case r := <-st.logReqCh:
+			var evs []Event
+			for i := r.from; i <= r.to; i++ {
+				evs = append(evs, st.log[i]...)
+			}
+			r.resp <- evs
+		case p := <-st.primeCh:
+			st.state = &state{p.ver, p.root}
+			st.head = p.ver + 1
+			for _, ls := range p.leases {
+				paths := make(map[string]bool, len(ls.paths))
+				for _, path := range ls.paths {
+					paths[path] = true
+				}
+				st.leases[ls.id] = &leaseState{
+					ttl:     ls.ttl,
+					expires: time.Now().Add(ls.remaining),
+					paths:   paths,
+				}
+				if ls.id > st.nextLease {
+					st.nextLease = ls.id
+				}
+			}
+			st.resetLeaseTimer()
+		case r := <-st.leasesReqCh:
+			ls := make([]leaseSnapshot, 0, len(st.leases))
+			for id, l := range st.leases {
+				paths := make([]string, 0, len(l.paths))
+				for path := range l.paths {
+					paths = append(paths, path)
+				}
+				ls = append(ls, leaseSnapshot{
+					id:        id,
+					ttl:       l.ttl,
+					remaining: l.expires.Sub(time.Now()),
+					paths:     paths,
+				})
+			}
+			r.resp <- ls
+		case r := <-st.newLeaseCh:
+			st.nextLease++
+			id := st.nextLease
+			st.leases[id] = &leaseState{
+				ttl:     r.ttl,
+				expires: time.Now().Add(r.ttl),
+				paths:   map[string]bool{},
+			}
+			st.resetLeaseTimer()
+			r.resp <- id
+		case id := <-st.renewLeaseCh:
+			if ls, ok := st.leases[id]; ok {
+				ls.expires = time.Now().Add(ls.ttl)
+				st.resetLeaseTimer()
+			}
+		case id := <-st.revokeLeaseCh:
+			if ls, ok := st.leases[id]; ok {
+				st.queueLeaseExpiry(ver+1, ls)
+				delete(st.leases, id)
+				st.resetLeaseTimer()
+			}
+		case now := <-st.leaseTimer.C:
+			// One running counter for the whole sweep: every lease expiring
+			// in this tick gets its Dels queued at consecutive Seqns, so two
+			// leases expiring together never race for the same Seqn.
+			seqn := ver + 1
+			for id, ls := range st.leases {
+				if !now.Before(ls.expires) {
+					seqn = st.queueLeaseExpiry(seqn, ls)
+					delete(st.leases, id)
+				}
+			}
+			st.resetLeaseTimer()
 		case seqns <- ver:
 			// nothing to do here
 		case watches <- len(st.watches):
@@ -270,7 +722,7 @@ func (st *Store) process(ops <-chan Op, seqns chan<- int64, watches chan<- int)
 			// nothing
 		}
 
-		var ev Event
+		var evs []Event
 		// If we have any mutations that can be applied, do them.
 		for len(st.todo) > 0 {
 			i := firstTodo(st.todo)
@@ -288,24 +740,157 @@ func (st *Store) process(ops <-chan Op, seqns chan<- int64, watches chan<- int)
 				continue
 			}
 
-			values, ev = values.apply(t.Seqn, t.Mut)
-			st.state = &state{ev.Seqn, values}
-			ver = ev.Seqn
+			values, evs = values.apply(t.Seqn, t.Mut)
+			st.state = &state{t.Seqn, values}
+			ver = t.Seqn
+			st.trackLease(evs, t.Mut)
 			if !flush {
-				st.log[ev.Seqn] = ev
-				st.watches = st.notify(ev, st.watches)
+				st.log[t.Seqn] = evs
+				st.watches = st.notify(evs, st.watches)
 			}
 		}
 
-		// A flush just gets one final event.
+		// A flush just gets the final Seqn's events.
 		if flush {
-			st.log[ev.Seqn] = ev
-			st.watches = st.notify(ev, st.watches)
+			st.log[ver] = evs
+			st.watches = st.notify(evs, st.watches)
 			st.head = ver + 1
 		}
 	}
 }
 
+// trackLease attaches a successful Set's path to the lease (or new,
+// implicitly-created lease) named by mut's ";lease="/";ttl=" suffix, if
+// any. It's a no-op for everything else: deletes, tree deletes, txns, nops,
+// and failed mutations. A tree delete returns early either on its Event
+// count or, when it yields a single Event, because it isn't a Set.
+func (st *Store) trackLease(evs []Event, mut string) {
+	if len(evs) != 1 || mut == Nop || strings.HasPrefix(mut, "txn:") {
+		return
+	}
+	ev := evs[0]
+	if ev.Err != nil {
+		return
+	}
+
+	d, err := decode(mut)
+	if err != nil || !d.keep {
+		return
+	}
+
+	switch {
+	case d.hasLease:
+		if ls, ok := st.leases[d.leaseID]; ok {
+			ls.paths[ev.Path] = true
+		}
+	case d.hasTTL:
+		st.nextLease++
+		st.leases[st.nextLease] = &leaseState{
+			ttl:     d.ttl,
+			expires: time.Now().Add(d.ttl),
+			paths:   map[string]bool{ev.Path: true},
+		}
+		st.resetLeaseTimer()
+	}
+}
+
+// queueLeaseExpiry synthesizes a Del mutation for every path attached to
+// ls, queued at consecutive Seqns starting at seqn -- the same way any
+// other burst of Ops waits to be applied by process's normal todo loop. It
+// returns the next unused Seqn, so callers expiring several leases in one
+// sweep can thread a single counter through and avoid handing out the same
+// Seqn twice.
+func (st *Store) queueLeaseExpiry(seqn int64, ls *leaseState) int64 {
+	for path := range ls.paths {
+		st.todo = append(st.todo, Op{Seqn: seqn, Mut: MustEncodeDel(path, Clobber)})
+		seqn++
+	}
+	return seqn
+}
+
+// resetLeaseTimer reschedules st.leaseTimer to fire at the next lease's
+// expiry, or after leaseIdleInterval if there are none outstanding.
+func (st *Store) resetLeaseTimer() {
+	if !st.leaseTimer.Stop() {
+		select {
+		case <-st.leaseTimer.C:
+		default:
+		}
+	}
+
+	var next time.Time
+	for _, ls := range st.leases {
+		if next.IsZero() || ls.expires.Before(next) {
+			next = ls.expires
+		}
+	}
+
+	if next.IsZero() {
+		st.leaseTimer.Reset(leaseIdleInterval)
+		return
+	}
+
+	d := next.Sub(time.Now())
+	if d < 0 {
+		d = 0
+	}
+	st.leaseTimer.Reset(d)
+}
+
+// NewLease creates a session lease that expires ttl from now unless renewed
+// with RenewLease. Attach files to it with EncodeSetLease so they're
+// removed automatically on expiry or RevokeLease.
+func (st *Store) NewLease(ttl time.Duration) LeaseID {
+	resp := make(chan LeaseID)
+	st.newLeaseCh <- newLeaseReq{ttl: ttl, resp: resp}
+	return <-resp
+}
+
+// RenewLease extends id's expiry to ttl (its original TTL, from NewLease)
+// from now. It's a no-op if id names a lease that's already expired or
+// been revoked.
+func (st *Store) RenewLease(id LeaseID) {
+	st.renewLeaseCh <- id
+}
+
+// RevokeLease expires id immediately, deleting every path attached to it.
+// It's a no-op if id names a lease that's already expired or been revoked.
+func (st *Store) RevokeLease(id LeaseID) {
+	st.revokeLeaseCh <- id
+}
+
+// leaseSnapshots returns a point-in-time copy of every outstanding lease,
+// for Snapshotter to persist.
+func (st *Store) leaseSnapshots() []leaseSnapshot {
+	resp := make(chan []leaseSnapshot)
+	st.leasesReqCh <- leasesReq{resp}
+	return <-resp
+}
+
+// Returns a mutation that can be applied to a `Store`, just like
+// EncodeSet, but ties path to lease: when the lease expires or is revoked,
+// path is deleted automatically.
+func EncodeSetLease(path, body string, rev int64, lease LeaseID) (mutation string, err error) {
+	m, err := EncodeSet(path, body, rev)
+	if err != nil {
+		return
+	}
+	return m + ";lease=" + strconv.FormatInt(int64(lease), 10), nil
+}
+
+// Returns a mutation that can be applied to a `Store`, just like
+// EncodeSet, but marks path ephemeral with its own dedicated lease of ttl:
+// path is deleted automatically once ttl elapses, with no further calls
+// needed to manage the lease. ttl is encoded in whole seconds, rounded
+// down, so a ttl under one second expires at once.
+func EncodeSetTTL(path, body string, rev int64, ttl time.Duration) (mutation string, err error) {
+	m, err := EncodeSet(path, body, rev)
+	if err != nil {
+		return
+	}
+	return m + ";ttl=" + strconv.FormatInt(int64(ttl/time.Second), 10), nil
+}
+
 // Find Min Value
 func firstTodo(a []Op) (pos int) {
 	n := int64(math.MaxInt64)
@@ -382,3 +967,97 @@ func (st *Store) Wait(glob *Glob, rev int64) (<-chan Event, error) {
 func (st *Store) Clean(seqn int64) {
 	st.cleanCh <- seqn
 }
+
+// Events returns every retained Event with Seqn in [from, to], in order.
+// Events at or before the last Seqn passed to Clean are no longer retained
+// and simply won't appear in the result. It backs Snapshotter's delta
+// stream.
+func (st *Store) Events(from, to int64) []Event {
+	resp := make(chan []Event)
+	st.logReqCh <- logReq{from, to, resp}
+	return <-resp
+}
+
+// A Subscription is a long-lived counterpart to the one-shot channel
+// returned by Wait. Where a Wait caller has to notice its Event, then call
+// Wait again with rev = ev.Rev+1 to keep watching, a Subscription keeps
+// delivering matching Events on C until Close is called.
+type Subscription struct {
+	// C delivers every Event matching the Subscription's glob from its
+	// starting rev onward. A gap in delivery (the consumer fell behind and
+	// the buffer filled) is signalled by an Event whose Err is ErrTooLate;
+	// the consumer should resynchronize with Snap when it sees one.
+	C <-chan Event
+
+	st *Store
+	w  *watch
+
+	closeOnce sync.Once
+
+	mu    sync.Mutex
+	acked int64
+}
+
+// Watch returns a Subscription delivering every Event matching glob from
+// sinceRev onward, buffering up to buf undelivered Events.
+func (st *Store) Watch(glob *Glob, sinceRev int64, buf int) (*Subscription, error) {
+	if sinceRev < 1 {
+		sinceRev = 1
+	}
+
+	ch := make(chan Event, buf)
+	w := &watch{
+		glob:       glob,
+		rev:        sinceRev,
+		c:          ch,
+		persistent: true,
+	}
+	st.watchCh <- w
+
+	if sinceRev < st.head {
+		return nil, ErrTooLate
+	}
+
+	return &Subscription{C: ch, st: st, w: w}, nil
+}
+
+// Ack records that the consumer has processed every Event up to and
+// including rev. It's bookkeeping for the consumer's own benefit (e.g.
+// knowing where to resume a Watch after a restart); flow control itself is
+// handled by the Subscription's buffer.
+func (s *Subscription) Ack(rev int64) {
+	s.mu.Lock()
+	if rev > s.acked {
+		s.acked = rev
+	}
+	s.mu.Unlock()
+}
+
+// Acked returns the highest rev passed to Ack so far.
+func (s *Subscription) Acked() int64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.acked
+}
+
+// Close stops delivery and removes the Subscription from the Store. C is
+// closed. Close is safe to call more than once; only the first call has
+// any effect.
+func (s *Subscription) Close() {
+	s.closeOnce.Do(func() {
+		s.st.unwatchCh <- s.w
+	})
+}
+
+// DelTree removes the subtree rooted at path (and path itself), claiming
+// the next available Seqn itself.
+func (st *Store) DelTree(path string, rev int64) error {
+	mutation, err := EncodeDelTree(path, rev)
+	if err != nil {
+		return err
+	}
+
+	seqn := <-st.Seqns + 1
+	st.Ops <- Op{Seqn: seqn, Mut: mutation}
+	return nil
+}
@@ -0,0 +1,58 @@
+package store
+
+import "testing"
+
+func pushAndWait(t *testing.T, st *Store, mut string) int64 {
+	t.Helper()
+	seqn := <-st.Seqns + 1
+	st.Ops <- Op{Seqn: seqn, Mut: mut}
+	if v := <-st.Seqns; v != seqn {
+		t.Fatalf("store did not apply seqn %d (at %d)", seqn, v)
+	}
+	return seqn
+}
+
+// A txn op that collides with an existing node's type (Set under a file,
+// or Set/Del where a dir already sits) must fail the whole txn instead of
+// silently corrupting the tree the way a bare setp call would.
+func TestTxnOpTypeConflictFailsWholeTxn(t *testing.T) {
+	st := New()
+
+	mset := MustEncodeSet("/x", "body", Missing)
+	pushAndWait(t, st, mset)
+
+	mtxn, err := EncodeTxn(nil, []TxnOp{SetOp("/x/sub", "oops")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	pushAndWait(t, st, mtxn)
+
+	v, rev := st.Get("/x")
+	if rev != 1 || v[0] != "body" {
+		t.Fatalf("txn corrupted /x: rev=%d v=%v, want rev=1 v=[body]", rev, v)
+	}
+
+	_, errRev := st.Get(ErrorPath)
+	if errRev == Missing {
+		t.Fatalf("expected a failed txn to write an error Event to %s", ErrorPath)
+	}
+}
+
+// Ops in a txn that don't conflict with each other still all land
+// together, at the txn's Seqn.
+func TestTxnOpsApplyTogether(t *testing.T) {
+	st := New()
+
+	mtxn, err := EncodeTxn(nil, []TxnOp{SetOp("/a", "1"), SetOp("/b", "2")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	pushAndWait(t, st, mtxn)
+
+	if v, rev := st.Get("/a"); rev == Missing || v[0] != "1" {
+		t.Fatalf("/a not set by txn: rev=%d v=%v", rev, v)
+	}
+	if v, rev := st.Get("/b"); rev == Missing || v[0] != "2" {
+		t.Fatalf("/b not set by txn: rev=%d v=%v", rev, v)
+	}
+}
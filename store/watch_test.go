@@ -0,0 +1,77 @@
+package store
+
+import (
+	"testing"
+	"time"
+)
+
+// A multi-leaf DelTree produces more than one Event at the same Seqn. A
+// persistent Watch subscription must see every leaf, not just the first
+// one notify happens to check against w.rev.
+func TestWatchSeesEveryLeafOfDelTree(t *testing.T) {
+	st := New()
+
+	pushAndWait(t, st, MustEncodeSet("/foo/a", "1", Missing))
+	seqn := pushAndWait(t, st, MustEncodeSet("/foo/b", "1", Missing))
+
+	sub, err := st.Watch(Any, seqn+1, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sub.Close()
+
+	delSeqn := pushAndWait(t, st, MustEncodeDelTree("/foo", Clobber))
+
+	seen := map[string]bool{}
+	for len(seen) < 2 {
+		select {
+		case e := <-sub.C:
+			if e.Seqn != delSeqn {
+				t.Fatalf("unexpected event seqn %d, want %d", e.Seqn, delSeqn)
+			}
+			seen[e.Path] = true
+		case <-time.After(2 * time.Second):
+			t.Fatalf("timed out waiting for both leaves, got %v", seen)
+		}
+	}
+}
+
+// Close must tolerate being called more than once -- e.g. an explicit
+// Close on an error path followed by a deferred one -- without sending
+// the same watch to unwatchCh twice and panicking process on a
+// close-of-closed-channel.
+func TestSubscriptionCloseIsIdempotent(t *testing.T) {
+	st := New()
+
+	sub, err := st.Watch(Any, 1, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sub.Close()
+	sub.Close()
+}
+
+// When a Subscription's buffer is full, the newest Event is dropped in
+// favor of an ErrTooLate gap marker, so the consumer notices it fell
+// behind instead of quietly missing an update.
+func TestWatchBackpressureSendsGapMarker(t *testing.T) {
+	st := New()
+
+	sub, err := st.Watch(Any, 1, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sub.Close()
+
+	pushAndWait(t, st, MustEncodeSet("/a", "1", Missing))
+	seqn := pushAndWait(t, st, MustEncodeSet("/b", "1", Missing))
+
+	e := <-sub.C
+	if e.Err != ErrTooLate {
+		t.Fatalf("expected the overflowed buffer to report ErrTooLate, got %+v", e)
+	}
+	if e.Seqn != seqn {
+		t.Fatalf("expected the gap marker at seqn %d, got %d", seqn, e.Seqn)
+	}
+}